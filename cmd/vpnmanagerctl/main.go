@@ -0,0 +1,142 @@
+// Command vpnmanagerctl talks to a running vpn-manager over its control
+// socket, for the operations that used to require editing the YAML config
+// and restarting: inspecting interface status, adding one-off no-vpn
+// routes, forcing an interface out of rotation, and reloading config.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+
+	"dnshook/pkg/control"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func main() {
+	socketPath := flag.String("socket", control.DefaultSocketPath, "control socket path")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	conn, err := grpc.Dial("unix-socket",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", *socketPath)
+		}),
+	)
+	if err != nil {
+		fatal(err)
+	}
+	defer conn.Close()
+
+	client := control.NewControlClient(conn)
+	if err := dispatch(client, args); err != nil {
+		fatal(err)
+	}
+}
+
+func dispatch(client *control.ControlClient, args []string) error {
+	ctx := context.Background()
+	switch args[0] {
+	case "status":
+		reply, err := client.Status(ctx, &control.Empty{})
+		if err != nil {
+			return err
+		}
+		for _, iface := range reply.Interfaces {
+			fmt.Printf("%s\tstatus=%s\tweight=%d\tmark=%s\n", iface.Name, iface.Status, iface.Weight, iface.Mark)
+		}
+		return nil
+
+	case "route":
+		return dispatchRoute(ctx, client, args[1:])
+
+	case "interface":
+		return dispatchInterface(ctx, client, args[1:])
+
+	case "reload":
+		_, err := client.ReloadConfig(ctx, &control.Empty{})
+		return err
+
+	case "dump":
+		reply, err := client.DumpState(ctx, &control.Empty{})
+		if err != nil {
+			return err
+		}
+		fmt.Print(reply.State)
+		return nil
+
+	default:
+		usage()
+		os.Exit(2)
+		return nil
+	}
+}
+
+func dispatchRoute(ctx context.Context, client *control.ControlClient, args []string) error {
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+	var err error
+	switch args[0] {
+	case "add":
+		_, err = client.AddNoVpnDomainIp(ctx, &control.DomainIPRequest{IPs: args[1:]})
+	case "del":
+		_, err = client.DelNoVpnDomainIp(ctx, &control.DomainIPRequest{IPs: args[1:]})
+	case "flush":
+		_, err = client.FlushNoVpnDomainIp(ctx, &control.Empty{})
+	default:
+		usage()
+		os.Exit(2)
+	}
+	return err
+}
+
+func dispatchInterface(ctx context.Context, client *control.ControlClient, args []string) error {
+	if len(args) != 2 {
+		usage()
+		os.Exit(2)
+	}
+	var disable bool
+	switch args[0] {
+	case "disable":
+		disable = true
+	case "enable":
+		disable = false
+	default:
+		usage()
+		os.Exit(2)
+	}
+	_, err := client.SetInterface(ctx, &control.InterfaceRequest{Name: args[1], Disable: disable})
+	return err
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: vpnmanagerctl [-socket path] <command>
+
+commands:
+  status
+  route add <ip>...
+  route del <ip>...
+  route flush
+  interface disable <name>
+  interface enable <name>
+  reload
+  dump`)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "vpnmanagerctl:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,110 @@
+// Package allowlist provides CIDR- and interface-name-based routing rules,
+// modeled on Nebula's AllowList/RemoteAllowList: a prefix trie gives
+// longest-prefix-match semantics over "no-vpn-cidrs" (bypass the VPN) and
+// "vpn-only-cidrs" (force traffic onto the VPN even if a denylist rule would
+// otherwise let it out), with an optional set of interface name rules.
+package allowlist
+
+import (
+	"net"
+	"regexp"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Config is the on-disk shape of an allowlist: CIDRs to route around the
+// VPN, CIDRs to force through it, and name-based rules for LAN interfaces.
+// Interfaces is evaluated as a set of regexps, longest pattern first, so
+// e.g. {"eth0": true, "wg+": false} lets a specific interface override a
+// wildcard.
+type Config struct {
+	NoVpnCidrs   []string        `yaml:"no-vpn-cidrs"`
+	VpnOnlyCidrs []string        `yaml:"vpn-only-cidrs"`
+	Interfaces   map[string]bool `yaml:"interfaces"`
+}
+
+type ifaceRule struct {
+	pattern *regexp.Regexp
+	allow   bool
+}
+
+// AllowList is the built, queryable form of a Config.
+type AllowList struct {
+	trie       *cidrTrie
+	ifaceRules []ifaceRule
+
+	noVpnCidrs   []string
+	vpnOnlyCidrs []string
+}
+
+// New builds an AllowList from cfg, validating every CIDR and interface
+// pattern up front so bad config is caught at startup, not at lookup time.
+func New(cfg Config) (*AllowList, error) {
+	t := newCIDRTrie()
+	for _, cidr := range cfg.NoVpnCidrs {
+		if err := t.insert(cidr, false); err != nil {
+			return nil, errors.Wrap(err, "no-vpn-cidrs")
+		}
+	}
+	for _, cidr := range cfg.VpnOnlyCidrs {
+		if err := t.insert(cidr, true); err != nil {
+			return nil, errors.Wrap(err, "vpn-only-cidrs")
+		}
+	}
+
+	names := make([]string, 0, len(cfg.Interfaces))
+	for name := range cfg.Interfaces {
+		names = append(names, name)
+	}
+	// Longest pattern first: a specific name like "eth0" should win over a
+	// broader wildcard like "wg+" regardless of map iteration order.
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+
+	rules := make([]ifaceRule, 0, len(names))
+	for _, name := range names {
+		re, err := regexp.Compile(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "interfaces: invalid pattern %q", name)
+		}
+		rules = append(rules, ifaceRule{pattern: re, allow: cfg.Interfaces[name]})
+	}
+
+	return &AllowList{
+		trie:         t,
+		ifaceRules:   rules,
+		noVpnCidrs:   cfg.NoVpnCidrs,
+		vpnOnlyCidrs: cfg.VpnOnlyCidrs,
+	}, nil
+}
+
+// AllowIP reports the routing decision for ip from the longest matching
+// CIDR rule: allow=true means the destination must go through the VPN
+// (vpn-only), allow=false means it should bypass it (no-vpn). matched=false
+// means no CIDR rule covers ip, and the caller should fall back to its
+// domain-based rules.
+func (a *AllowList) AllowIP(ip net.IP) (allow bool, matched bool) {
+	return a.trie.match(ip)
+}
+
+// AllowInterface reports the routing decision for a LAN interface name from
+// the most specific matching pattern. matched=false means no rule applies.
+func (a *AllowList) AllowInterface(name string) (allow bool, matched bool) {
+	for _, r := range a.ifaceRules {
+		if r.pattern.MatchString(name) {
+			return r.allow, true
+		}
+	}
+	return false, false
+}
+
+// NoVpnCIDRs returns the configured no-vpn-cidrs, for seeding no_vpn_ip_set.
+func (a *AllowList) NoVpnCIDRs() []string {
+	return a.noVpnCidrs
+}
+
+// VpnOnlyCIDRs returns the configured vpn-only-cidrs, for seeding
+// vpn_only_ip_set.
+func (a *AllowList) VpnOnlyCIDRs() []string {
+	return a.vpnOnlyCidrs
+}
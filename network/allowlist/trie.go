@@ -0,0 +1,78 @@
+package allowlist
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// cidrTrie is a binary radix trie over IPv4 prefixes, keyed bit-by-bit from
+// the most significant bit. Each node optionally carries a value; lookups
+// walk from the root towards the address and remember the value of the
+// deepest node visited, giving longest-prefix-match semantics.
+type cidrTrie struct {
+	root *trieNode
+}
+
+type trieNode struct {
+	children [2]*trieNode
+	hasValue bool
+	value    bool
+}
+
+func newCIDRTrie() *cidrTrie {
+	return &cidrTrie{root: &trieNode{}}
+}
+
+func (t *cidrTrie) insert(cidr string, value bool) error {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return errors.Wrapf(err, "invalid CIDR or IP %q", cidr)
+		}
+		ipnet = &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}
+	}
+	v4 := ipnet.IP.To4()
+	if v4 == nil {
+		return errors.Errorf("%q is not an IPv4 prefix", cidr)
+	}
+	ones, _ := ipnet.Mask.Size()
+
+	node := t.root
+	for i := 0; i < ones; i++ {
+		bit := bitAt(v4, i)
+		if node.children[bit] == nil {
+			node.children[bit] = &trieNode{}
+		}
+		node = node.children[bit]
+	}
+	node.hasValue = true
+	node.value = value
+	return nil
+}
+
+// match walks the trie towards ip, returning the value of the
+// longest (deepest) prefix that has one set.
+func (t *cidrTrie) match(ip net.IP) (value bool, matched bool) {
+	v4 := ip.To4()
+	if v4 == nil {
+		return false, false
+	}
+	node := t.root
+	if node.hasValue {
+		value, matched = node.value, true
+	}
+	for i := 0; i < 32 && node != nil; i++ {
+		bit := bitAt(v4, i)
+		node = node.children[bit]
+		if node != nil && node.hasValue {
+			value, matched = node.value, true
+		}
+	}
+	return value, matched
+}
+
+func bitAt(ip net.IP, i int) byte {
+	return (ip[i/8] >> (7 - uint(i%8))) & 1
+}
@@ -0,0 +1,84 @@
+// Package config holds vpn-manager's on-disk configuration schema, kept
+// separate from the firewall/ethernet/manager packages so none of them need
+// to import each other just to describe a VPN interface.
+package config
+
+import "time"
+
+// Interface describes one VPN interface vpn-manager balances traffic over.
+type Interface struct {
+	Name   string `yaml:"name"`
+	Weight int    `yaml:"weight"`
+	Mark   string `yaml:"mark"`
+	// HealthChecks lists the probes used to decide whether this interface
+	// is reachable. If empty, the interface falls back to a plain ICMP
+	// ping against Config.PingAddresses.
+	HealthChecks []ProbeConfig `yaml:"health-checks"`
+}
+
+// ProbeConfig describes one health-check probe bound to a VPN interface.
+// Type selects which fields apply: "tcp" uses Target, "https" uses URL and
+// ExpectStatus, "dns" uses Server and Query. An empty/"icmp" Type probes
+// Target with ping; a probe without a Target is rejected. Config.PingAddresses
+// is only used when an interface has no HealthChecks at all.
+type ProbeConfig struct {
+	Type             string        `yaml:"type"`
+	Target           string        `yaml:"target"`
+	URL              string        `yaml:"url"`
+	ExpectStatus     int           `yaml:"expect-status"`
+	Server           string        `yaml:"server"`
+	Query            string        `yaml:"query"`
+	Interval         time.Duration `yaml:"interval"`
+	Timeout          time.Duration `yaml:"timeout"`
+	FailureThreshold int           `yaml:"failure-threshold"`
+	SuccessThreshold int           `yaml:"success-threshold"`
+}
+
+type Config struct {
+	VpnInterfaces      []Interface `yaml:"vpn-interfaces"`
+	LanInterfaces      []string    `yaml:"lan-interfaces"`
+	NoVpnIps           []string    `yaml:"no-vpn-ips"`
+	PingAddresses      []string    `yaml:"ping-addresses"`
+	PingTimeoutSeconds int         `yaml:"ping-timeout-seconds"`
+	// NftBackend selects how nftables rules are applied: "netlink" (default)
+	// talks to the kernel directly, "cli" shells out to `nft` for OpenWrt
+	// targets that don't bundle the netlink library.
+	NftBackend string `yaml:"nft-backend"`
+	// NoVpnCidrs and VpnOnlyCidrs feed the allowlist's CIDR trie: the former
+	// bypasses the VPN, the latter forces traffic onto it even over a
+	// matching no-vpn rule. Interfaces applies the same allow/deny decision
+	// by LAN interface name (regex, longest pattern wins).
+	NoVpnCidrs   []string        `yaml:"no-vpn-cidrs"`
+	VpnOnlyCidrs []string        `yaml:"vpn-only-cidrs"`
+	Interfaces   map[string]bool `yaml:"interfaces"`
+	// LoadBalance selects how traffic is scheduled across active VPN
+	// interfaces; see LoadBalance's doc comment for the available modes.
+	LoadBalance LoadBalance `yaml:"load-balance"`
+	// MetricsAddr, if set, serves Prometheus metrics at "/metrics" on this
+	// address (e.g. "127.0.0.1:9100"). Left empty, no metrics server runs.
+	MetricsAddr string `yaml:"metrics-addr"`
+}
+
+// LoadBalance selects the scheduling algorithm for traffic across active
+// VPN interfaces: "wrr" (default) spreads new connections in proportion to
+// weight, "hash" pins a flow to one interface by hashing HashKeys, and
+// "failover" always prefers the highest-weight interface, falling back to
+// the next only once it's down.
+type LoadBalance struct {
+	Mode     string   `yaml:"mode"`
+	HashKeys []string `yaml:"hash-keys"`
+}
+
+var Default = Config{
+	VpnInterfaces: []Interface{
+		{Name: "vpn", Weight: 1, Mark: "0x3e9"},
+	},
+	LanInterfaces:      []string{"br-lan"},
+	NoVpnIps:           []string{"192.168.0.0/16"},
+	PingAddresses:      []string{"8.8.8.8", "cloudflare.com"},
+	PingTimeoutSeconds: 4,
+	NftBackend:         "netlink",
+}
+
+// FileName is the on-disk location read by dnshook/pkg/config.
+const FileName = "/etc/vpnmanager/config.yml"
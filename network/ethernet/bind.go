@@ -0,0 +1,29 @@
+//go:build linux
+
+package ethernet
+
+import (
+	"net"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// dialerBoundTo returns a net.Dialer whose sockets are bound to ifaceName
+// via SO_BINDTODEVICE, so a probe actually traverses that VPN tunnel
+// instead of whatever route the default table would otherwise pick.
+func dialerBoundTo(ifaceName string, timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(_, _ string, c syscall.RawConn) error {
+			var bindErr error
+			if err := c.Control(func(fd uintptr) {
+				bindErr = unix.BindToDevice(int(fd), ifaceName)
+			}); err != nil {
+				return err
+			}
+			return bindErr
+		},
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package ethernet
+
+import (
+	"net"
+	"time"
+)
+
+// dialerBoundTo on non-Linux platforms just returns a plain dialer;
+// SO_BINDTODEVICE is Linux-only, and vpn-manager otherwise only targets
+// Linux (OpenWrt) anyway.
+func dialerBoundTo(_ string, timeout time.Duration) *net.Dialer {
+	return &net.Dialer{Timeout: timeout}
+}
@@ -0,0 +1,205 @@
+// Package ethernet keeps track of whether a VPN interface is actually
+// reachable, by periodically running one or more probes (ICMP, TCP-connect,
+// HTTPS, or DNS) through it.
+package ethernet
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"dnshook/network/config"
+	"dnshook/network/metrics"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Status is the health-checker's up/degraded/down state machine. Going Up
+// or Down requires a run of consecutive successes or failures; a single
+// failed round only moves an Up interface to Degraded, which stays in
+// rotation, so a single dropped probe doesn't pull it out of the routing
+// rules.
+type Status int
+
+const (
+	Down Status = iota
+	Degraded
+	Up
+)
+
+func (s Status) String() string {
+	switch s {
+	case Up:
+		return "up"
+	case Degraded:
+		return "degraded"
+	default:
+		return "down"
+	}
+}
+
+// Checker watches a single VPN interface and calls onStatusChanged whenever
+// its Status changes.
+type Checker struct {
+	config.Interface
+
+	probes           []Probe
+	interval         time.Duration
+	failureThreshold int
+	successThreshold int
+
+	onStatusChanged func()
+	log             logrus.FieldLogger
+	metrics         *metrics.Metrics
+
+	mu            sync.Mutex
+	status        Status
+	consecFail    int
+	consecSuccess int
+	forcedDown    bool
+}
+
+// New builds a Checker for iface. If iface has no HealthChecks configured,
+// it falls back to a single ICMP probe per address in pingAddr (the legacy
+// behavior), using pingTimeout as both the probe timeout and the check
+// interval. m may be nil, in which case no ping_rtt_seconds samples are
+// recorded.
+func New(iface config.Interface, pingTimeout time.Duration, pingAddr []string, onStatusChanged func(), log logrus.FieldLogger, m *metrics.Metrics) *Checker {
+	if log == nil {
+		log = logrus.StandardLogger()
+	}
+
+	checks := iface.HealthChecks
+	if len(checks) == 0 {
+		for _, addr := range pingAddr {
+			checks = append(checks, config.ProbeConfig{Type: "icmp", Target: addr, Timeout: pingTimeout, Interval: pingTimeout})
+		}
+	}
+
+	c := &Checker{
+		Interface:       iface,
+		interval:        pingTimeout,
+		onStatusChanged: onStatusChanged,
+		log:             log.WithField("interface", iface.Name),
+		metrics:         m,
+		status:          Down,
+	}
+	for _, check := range checks {
+		probe, resolved, err := newProbe(check)
+		if err != nil {
+			c.log.WithError(err).WithField("type", check.Type).Error("invalid health check, skipping")
+			continue
+		}
+		c.probes = append(c.probes, probe)
+		if resolved.Interval > c.interval {
+			c.interval = resolved.Interval
+		}
+		if c.failureThreshold < resolved.FailureThreshold {
+			c.failureThreshold = resolved.FailureThreshold
+		}
+		if c.successThreshold < resolved.SuccessThreshold {
+			c.successThreshold = resolved.SuccessThreshold
+		}
+	}
+	if c.interval <= 0 {
+		c.interval = defaultInterval
+	}
+	if c.failureThreshold <= 0 {
+		c.failureThreshold = defaultFailureThreshold
+	}
+	if c.successThreshold <= 0 {
+		c.successThreshold = defaultSuccessThreshold
+	}
+	return c
+}
+
+func (c *Checker) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// SetForcedDown lets an operator take an interface out of rotation (e.g.
+// via the control API) regardless of what its probes report; clearing it
+// lets the next check() results apply normally.
+func (c *Checker) SetForcedDown(forced bool) {
+	c.mu.Lock()
+	c.forcedDown = forced
+	changed := forced && c.status != Down
+	if changed {
+		c.status = Down
+	}
+	c.mu.Unlock()
+	if changed && c.onStatusChanged != nil {
+		c.onStatusChanged()
+	}
+}
+
+// KeepCheck blocks, running every probe on every tick until ctx is
+// cancelled, calling onStatusChanged whenever Status changes.
+func (c *Checker) KeepCheck(ctx context.Context) {
+	c.check(ctx)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.check(ctx)
+		}
+	}
+}
+
+// check runs every configured probe; the interface is only considered
+// reachable this round if ALL of them succeed.
+func (c *Checker) check(ctx context.Context) {
+	ok := len(c.probes) > 0
+	for _, p := range c.probes {
+		checkCtx, cancel := context.WithTimeout(ctx, c.interval)
+		start := time.Now()
+		err := p.Check(checkCtx, c.Name)
+		rtt := time.Since(start)
+		cancel()
+		if c.metrics != nil {
+			c.metrics.PingRTT.WithLabelValues(c.Name, p.Target()).Observe(rtt.Seconds())
+		}
+		if err != nil {
+			c.log.WithError(err).Debug("health check probe failed")
+			ok = false
+			break
+		}
+	}
+
+	c.mu.Lock()
+	if ok {
+		c.consecSuccess++
+		c.consecFail = 0
+	} else {
+		c.consecFail++
+		c.consecSuccess = 0
+	}
+
+	newStatus := c.status
+	switch {
+	case c.forcedDown:
+		newStatus = Down
+	case c.consecFail >= c.failureThreshold:
+		newStatus = Down
+	case c.consecSuccess >= c.successThreshold:
+		newStatus = Up
+	case !ok && c.status == Up:
+		newStatus = Degraded
+	}
+	changed := newStatus != c.status
+	c.status = newStatus
+	c.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	c.log.WithField("status", newStatus).Info("vpn interface status changed")
+	if c.onStatusChanged != nil {
+		c.onStatusChanged()
+	}
+}
@@ -0,0 +1,75 @@
+package ethernet
+
+import (
+	"context"
+	"time"
+
+	"dnshook/network/config"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultInterval         = 5 * time.Second
+	defaultTimeout          = 2 * time.Second
+	defaultFailureThreshold = 3
+	defaultSuccessThreshold = 2
+)
+
+// Probe is a single reachability check, bound to one VPN interface so it
+// actually exercises that tunnel (e.g. via SO_BINDTODEVICE) rather than
+// whatever route the default routing table would pick.
+type Probe interface {
+	// Check returns nil if the probe succeeded, through the named
+	// interface, within ctx's deadline.
+	Check(ctx context.Context, ifaceName string) error
+	// Target names what was probed (an address, URL, or DNS server), for
+	// the ping_rtt_seconds metric's label.
+	Target() string
+}
+
+// newProbe builds a Probe from its config, filling in interval/timeout/
+// threshold defaults that weren't set.
+func newProbe(cfg config.ProbeConfig) (Probe, config.ProbeConfig, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultFailureThreshold
+	}
+	if cfg.SuccessThreshold <= 0 {
+		cfg.SuccessThreshold = defaultSuccessThreshold
+	}
+
+	switch cfg.Type {
+	case "", "icmp":
+		if cfg.Target == "" {
+			return nil, cfg, errors.New("icmp probe requires target")
+		}
+		return &icmpProbe{addr: cfg.Target, timeout: cfg.Timeout}, cfg, nil
+	case "tcp":
+		if cfg.Target == "" {
+			return nil, cfg, errors.New("tcp probe requires target")
+		}
+		return &tcpProbe{addr: cfg.Target, timeout: cfg.Timeout}, cfg, nil
+	case "https":
+		if cfg.URL == "" {
+			return nil, cfg, errors.New("https probe requires url")
+		}
+		expect := cfg.ExpectStatus
+		if expect == 0 {
+			expect = 200
+		}
+		return &httpsProbe{url: cfg.URL, expectStatus: expect, timeout: cfg.Timeout}, cfg, nil
+	case "dns":
+		if cfg.Server == "" || cfg.Query == "" {
+			return nil, cfg, errors.New("dns probe requires server and query")
+		}
+		return &dnsProbe{server: cfg.Server, query: cfg.Query, timeout: cfg.Timeout}, cfg, nil
+	default:
+		return nil, cfg, errors.Errorf("unknown health-check type %q", cfg.Type)
+	}
+}
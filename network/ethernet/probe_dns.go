@@ -0,0 +1,101 @@
+package ethernet
+
+import (
+	"context"
+	"encoding/binary"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// dnsProbe succeeds if server answers an A-record query for query, through
+// the interface, within timeout, without a server-side error RCODE.
+type dnsProbe struct {
+	server  string
+	query   string
+	timeout time.Duration
+}
+
+func (p *dnsProbe) Check(ctx context.Context, ifaceName string) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	addr := p.server
+	if !strings.Contains(addr, ":") {
+		addr += ":53"
+	}
+	conn, err := dialerBoundTo(ifaceName, p.timeout).DialContext(ctx, "udp", addr)
+	if err != nil {
+		return errors.Wrap(err, "dial dns server")
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	id := uint16(rand.Intn(1 << 16))
+	query, err := buildDNSQuery(id, p.query)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(query); err != nil {
+		return errors.Wrap(err, "send dns query")
+	}
+
+	buf := make([]byte, 512)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return errors.Wrap(err, "read dns response")
+	}
+	return parseDNSResponse(buf[:n], id)
+}
+
+func (p *dnsProbe) Target() string { return p.server }
+
+// buildDNSQuery encodes a minimal standard-query DNS message asking for the
+// A record of name.
+func buildDNSQuery(id uint16, name string) ([]byte, error) {
+	var buf []byte
+	header := make([]byte, 12)
+	binary.BigEndian.PutUint16(header[0:2], id)
+	header[2] = 0x01 // RD (recursion desired)
+	binary.BigEndian.PutUint16(header[4:6], 1)
+	buf = append(buf, header...)
+
+	for _, label := range strings.Split(strings.Trim(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, errors.Errorf("invalid dns query name %q", name)
+		}
+		buf = append(buf, byte(len(label)))
+		buf = append(buf, label...)
+	}
+	buf = append(buf, 0x00)       // end of name
+	buf = append(buf, 0x00, 0x01) // QTYPE A
+	buf = append(buf, 0x00, 0x01) // QCLASS IN
+	return buf, nil
+}
+
+// parseDNSResponse checks that buf is a well-formed response to id with a
+// non-error RCODE. It does not need to decode the answer records
+// themselves; a successful, clean response is enough to prove the
+// interface's DNS path is up.
+func parseDNSResponse(buf []byte, id uint16) error {
+	if len(buf) < 12 {
+		return errors.New("dns response too short")
+	}
+	gotID := binary.BigEndian.Uint16(buf[0:2])
+	if gotID != id {
+		return errors.Errorf("dns response id mismatch: got %d want %d", gotID, id)
+	}
+	flags := binary.BigEndian.Uint16(buf[2:4])
+	if flags&0x8000 == 0 {
+		return errors.New("dns response missing QR bit")
+	}
+	if rcode := flags & 0x000f; rcode != 0 {
+		return errors.Errorf("dns response rcode %d", rcode)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package ethernet
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// httpsProbe succeeds if a GET to url, through the interface, returns
+// expectStatus within timeout.
+type httpsProbe struct {
+	url          string
+	expectStatus int
+	timeout      time.Duration
+}
+
+func (p *httpsProbe) Check(ctx context.Context, ifaceName string) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	dialer := dialerBoundTo(ifaceName, p.timeout)
+	client := &http.Client{
+		Timeout: p.timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return errors.Wrap(err, "build request")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != p.expectStatus {
+		return errors.Errorf("unexpected status %d, want %d", resp.StatusCode, p.expectStatus)
+	}
+	return nil
+}
+
+func (p *httpsProbe) Target() string { return p.url }
@@ -0,0 +1,26 @@
+package ethernet
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// icmpProbe is the original health check: a single ICMP echo through the
+// interface.
+type icmpProbe struct {
+	addr    string
+	timeout time.Duration
+}
+
+func (p *icmpProbe) Check(ctx context.Context, ifaceName string) error {
+	seconds := int(p.timeout.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	cmd := exec.CommandContext(ctx, "ping", "-I", ifaceName, "-c", "1", "-W", fmt.Sprint(seconds), p.addr)
+	return cmd.Run()
+}
+
+func (p *icmpProbe) Target() string { return p.addr }
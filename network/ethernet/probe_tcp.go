@@ -0,0 +1,25 @@
+package ethernet
+
+import (
+	"context"
+	"time"
+)
+
+// tcpProbe succeeds if a TCP connection to addr ("host:port") completes
+// within timeout, bound to the VPN interface.
+type tcpProbe struct {
+	addr    string
+	timeout time.Duration
+}
+
+func (p *tcpProbe) Check(ctx context.Context, ifaceName string) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	conn, err := dialerBoundTo(ifaceName, p.timeout).DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (p *tcpProbe) Target() string { return p.addr }
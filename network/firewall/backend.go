@@ -0,0 +1,55 @@
+package firewall
+
+import "context"
+
+// NftBackend abstracts the ruleset operations vpn-manager needs from nftables.
+// It lets the implementation be swapped between a native netlink client and
+// the `nft` CLI, which is still required on OpenWrt builds that don't ship
+// the netlink library.
+type NftBackend interface {
+	// EnsureTable (re)creates the vpn_manager table with its sets, chains
+	// and the prerouting jump for the given LAN interfaces, replacing
+	// whatever table of that name already exists.
+	EnsureTable(ctx context.Context, lanInterfaces []string) error
+	AddSetElements(ctx context.Context, table, set string, elements []string) error
+	DelSetElements(ctx context.Context, table, set string, elements []string) error
+	FlushSet(ctx context.Context, table, set string) error
+	FlushChain(ctx context.Context, table, chain string) error
+	AddRule(ctx context.Context, table, chain string, rule ...string) error
+	AddMarkRule(ctx context.Context, table, chain, mark string) error
+	// AddCtMarkRestoreRule installs the "restore the conntrack-saved mark
+	// onto established/related connections" rule, so a flow keeps using
+	// the interface it was first load-balanced onto instead of being
+	// re-split by the new-connection rule AddWeightedMarkRule installs.
+	AddCtMarkRestoreRule(ctx context.Context, table, chain string) error
+	// AddWeightedMarkRule installs the new-connection load-balancing rule:
+	// picks a 0-99 bucket per opts.Mode's selector and maps it through
+	// ranges to an interface's mark.
+	AddWeightedMarkRule(ctx context.Context, table, chain string, opts LoadBalanceOptions, ranges []markRange) error
+	DeleteTable(ctx context.Context, table string) error
+	// Dump returns a human-readable listing of the table's current rules,
+	// for the control API's diagnostic "dump" command. It's a CLI-backed
+	// read-only operation regardless of which backend is active, since
+	// it's only ever called on operator demand, not the DNS hot path.
+	Dump(ctx context.Context, table string) (string, error)
+}
+
+// BackendKind selects which NftBackend implementation NewNftBackend builds.
+type BackendKind string
+
+const (
+	// BackendNetlink talks to the kernel directly over netlink. It is the
+	// default: no fork/exec per call, and errors come back structured
+	// instead of needing to be scraped out of CombinedOutput.
+	BackendNetlink BackendKind = "netlink"
+	// BackendCLI shells out to the `nft` binary. Kept for OpenWrt targets
+	// whose images don't bundle the netlink library.
+	BackendCLI BackendKind = "cli"
+)
+
+func NewNftBackend(kind BackendKind) NftBackend {
+	if kind == BackendCLI {
+		return &cliBackend{}
+	}
+	return newNetlinkBackend()
+}
@@ -0,0 +1,154 @@
+package firewall
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+const tableTmp = `
+table ip vpn_manager {
+
+    set no_vpn_domain_ip_set {
+        type ipv4_addr;
+    }
+
+    set no_vpn_ip_set {
+        type ipv4_addr;flags interval;
+    }
+
+    set vpn_only_ip_set {
+        type ipv4_addr;flags interval;
+    }
+
+    chain prerouting {
+        type filter hook prerouting priority 0;
+        {{.}}
+    }
+
+    chain select_export {
+        ip daddr @vpn_only_ip_set jump vpn
+        ip daddr @no_vpn_ip_set return
+        ip daddr @no_vpn_domain_ip_set return
+        jump vpn
+    }
+
+    chain vpn {
+        reject
+    }
+
+}
+`
+
+func renderTableScript(lanInterfaces []string) (string, error) {
+	var jump string
+	if len(lanInterfaces) == 1 {
+		jump = fmt.Sprintf("iifname %s jump select_export", lanInterfaces[0])
+	} else if len(lanInterfaces) > 1 {
+		jump = fmt.Sprintf("iifname { %s } jump select_export", strings.Join(lanInterfaces, ","))
+	}
+	tmp, err := template.New("table").Parse(tableTmp)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	var buf bytes.Buffer
+	if err = tmp.Execute(&buf, jump); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return buf.String(), nil
+}
+
+// cliBackend implements NftBackend by shelling out to the `nft` binary. It
+// exists for OpenWrt targets that don't ship github.com/google/nftables'
+// netlink dependencies; select it via the `nft-backend: cli` config key.
+type cliBackend struct{}
+
+func (c *cliBackend) EnsureTable(ctx context.Context, lanInterfaces []string) error {
+	script, err := renderTableScript(lanInterfaces)
+	if err != nil {
+		return err
+	}
+	// Declaring the table before deleting it lets the delete succeed even
+	// when no table exists yet, so the script always rebuilds it from
+	// scratch instead of merging into a previous copy.
+	reset := "table ip vpn_manager\ndelete table ip vpn_manager\n"
+	cmd := exec.CommandContext(ctx, "nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(reset + script)
+	return runCmd(cmd)
+}
+
+func (c *cliBackend) AddSetElements(ctx context.Context, table, set string, elements []string) error {
+	if len(elements) == 0 {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, "nft", "add", "element", "ip", table, set, fmt.Sprintf("{ %s }", strings.Join(elements, ",")))
+	return runCmd(cmd)
+}
+
+func (c *cliBackend) DelSetElements(ctx context.Context, table, set string, elements []string) error {
+	if len(elements) == 0 {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, "nft", "delete", "element", "ip", table, set, fmt.Sprintf("{ %s }", strings.Join(elements, ",")))
+	return runCmd(cmd)
+}
+
+func (c *cliBackend) FlushSet(ctx context.Context, table, set string) error {
+	cmd := exec.CommandContext(ctx, "nft", "flush", "set", "ip", table, set)
+	return runCmd(cmd)
+}
+
+func (c *cliBackend) FlushChain(ctx context.Context, table, chain string) error {
+	cmd := exec.CommandContext(ctx, "nft", "flush", "chain", "ip", table, chain)
+	return runCmd(cmd)
+}
+
+func (c *cliBackend) AddRule(ctx context.Context, table, chain string, rule ...string) error {
+	args := append([]string{"add", "rule", "ip", table, chain}, rule...)
+	cmd := exec.CommandContext(ctx, "nft", args...)
+	return runCmd(cmd)
+}
+
+func (c *cliBackend) AddMarkRule(ctx context.Context, table, chain, mark string) error {
+	return c.AddRule(ctx, table, chain, "meta", "mark", "set", mark)
+}
+
+func (c *cliBackend) AddCtMarkRestoreRule(ctx context.Context, table, chain string) error {
+	return c.AddRule(ctx, table, chain, "ct", "state", "established,related", "meta", "mark", "set", "ct", "mark")
+}
+
+func (c *cliBackend) AddWeightedMarkRule(ctx context.Context, table, chain string, opts LoadBalanceOptions, ranges []markRange) error {
+	selector := "numgen inc mod 100"
+	if opts.Mode == ModeHash {
+		selector = hashSelector(opts.HashKeys) + " mod 100"
+	}
+	between := formatRanges(ranges)
+	return c.AddRule(ctx, table, chain, append(strings.Fields("ct state new meta mark set "+selector+" map"), between)...)
+}
+
+func (c *cliBackend) DeleteTable(ctx context.Context, table string) error {
+	cmd := exec.CommandContext(ctx, "nft", "delete", "table", "ip", table)
+	return runCmd(cmd)
+}
+
+func (c *cliBackend) Dump(ctx context.Context, table string) (string, error) {
+	cmd := exec.CommandContext(ctx, "nft", "list", "table", "ip", table)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to execute cmd '%s', output: %s", cmd.String(), string(out))
+	}
+	return string(out), nil
+}
+
+func runCmd(cmd *exec.Cmd) error {
+	output, err := cmd.CombinedOutput() // 获取命令的输出和错误
+	if err != nil {
+		return errors.Wrapf(err, "failed to execute cmd '%s', output: %s", cmd.String(), string(output))
+	}
+	return nil
+}
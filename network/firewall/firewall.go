@@ -0,0 +1,224 @@
+package firewall
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"dnshook/network/ipset"
+	"dnshook/network/metrics"
+)
+
+const (
+	table            = "vpn_manager"
+	vpnChain         = "vpn"
+	noVpnDomainIPSet = "no_vpn_domain_ip_set"
+	noVpnIPSet       = "no_vpn_ip_set"
+	vpnOnlyIPSet     = "vpn_only_ip_set"
+)
+
+// ActiveInterface is the subset of an ethernet.Checker the firewall needs to
+// build the weighted-routing chain: a reachable VPN interface's mark and
+// relative weight.
+type ActiveInterface struct {
+	Name   string
+	Mark   string
+	Weight int
+}
+
+// LoadBalanceMode selects how traffic is split across active interfaces.
+type LoadBalanceMode string
+
+const (
+	// ModeWRR spreads new connections across interfaces in proportion to
+	// their weight, via an incrementing per-connection counter (numgen inc).
+	ModeWRR LoadBalanceMode = "wrr"
+	// ModeHash pins a flow to one interface for its lifetime by hashing
+	// the configured HashKeys, still in proportion to weight.
+	ModeHash LoadBalanceMode = "hash"
+	// ModeFailover sends all traffic through the single highest-weight
+	// active interface; the others are only used once it goes down.
+	ModeFailover LoadBalanceMode = "failover"
+)
+
+// LoadBalanceOptions configures SetChainRules' scheduling behavior.
+type LoadBalanceOptions struct {
+	Mode     LoadBalanceMode
+	HashKeys []string
+}
+
+// Firewall is everything the network Manager needs from nftables. It exists
+// so Manager can be unit-tested against a fake, and so multiple Managers can
+// run against independent firewall state.
+type Firewall interface {
+	EnsureTable(ctx context.Context, lanInterfaces []string) error
+	SetNoVpnIPs(ctx context.Context, cidrs []string) error
+	SetVpnOnlyIPs(ctx context.Context, cidrs []string) error
+	SetChainRules(ctx context.Context, active []ActiveInterface, opts LoadBalanceOptions) error
+	AddNoVpnDomainIP(ctx context.Context, ips ...string) error
+	DelNoVpnDomainIP(ctx context.Context, ips ...string) error
+	FlushNoVpnDomainIP(ctx context.Context) error
+	Clear(ctx context.Context) error
+	Dump(ctx context.Context) (string, error)
+}
+
+type nft struct {
+	backend  NftBackend
+	domainIP *ipset.Set
+}
+
+// New builds a Firewall backed by the given NftBackend kind ("netlink" or
+// "cli"; anything else falls back to netlink). m may be nil, in which case
+// no metrics are recorded.
+func New(kind BackendKind, m *metrics.Metrics) Firewall {
+	backend := InstrumentBackend(NewNftBackend(kind), m)
+	return &nft{
+		backend:  backend,
+		domainIP: ipset.New(backend, table, noVpnDomainIPSet).WithMetrics(m),
+	}
+}
+
+func (n *nft) EnsureTable(ctx context.Context, lanInterfaces []string) error {
+	return n.backend.EnsureTable(ctx, lanInterfaces)
+}
+
+func (n *nft) SetNoVpnIPs(ctx context.Context, cidrs []string) error {
+	if len(cidrs) == 0 {
+		return nil
+	}
+	return n.backend.AddSetElements(ctx, table, noVpnIPSet, cidrs)
+}
+
+func (n *nft) SetVpnOnlyIPs(ctx context.Context, cidrs []string) error {
+	if len(cidrs) == 0 {
+		return nil
+	}
+	return n.backend.AddSetElements(ctx, table, vpnOnlyIPSet, cidrs)
+}
+
+func (n *nft) AddNoVpnDomainIP(ctx context.Context, ips ...string) error {
+	return n.domainIP.Add(ctx, ips...)
+}
+
+func (n *nft) DelNoVpnDomainIP(ctx context.Context, ips ...string) error {
+	return n.domainIP.Del(ctx, ips...)
+}
+
+func (n *nft) FlushNoVpnDomainIP(ctx context.Context) error {
+	return n.domainIP.Flush(ctx)
+}
+
+func (n *nft) SetChainRules(ctx context.Context, active []ActiveInterface, opts LoadBalanceOptions) error {
+	if err := n.backend.FlushChain(ctx, table, vpnChain); err != nil {
+		return err
+	}
+	if len(active) == 0 {
+		return n.backend.AddRule(ctx, table, vpnChain, "reject")
+	}
+	if len(active) == 1 || opts.Mode == ModeFailover {
+		return n.backend.AddMarkRule(ctx, table, vpnChain, primary(active).Mark)
+	}
+
+	if err := n.backend.AddCtMarkRestoreRule(ctx, table, vpnChain); err != nil {
+		return err
+	}
+	return n.backend.AddWeightedMarkRule(ctx, table, vpnChain, opts, weightedRanges(active))
+}
+
+func (n *nft) Clear(ctx context.Context) error {
+	return n.backend.DeleteTable(ctx, table)
+}
+
+func (n *nft) Dump(ctx context.Context) (string, error) {
+	return n.backend.Dump(ctx, table)
+}
+
+// markRange is one [Start, End] (inclusive) bucket of the weighted-
+// round-robin map, assigned to Mark.
+type markRange struct {
+	Start, End int
+	Mark       string
+}
+
+// weightedRanges builds the cumulative weighted-round-robin interval map,
+// e.g. ranges covering 0-32, 33-65, 66-99 for equal weights {1,1,1}. Each
+// interface's range is [sum(weights[:i])/total*100, sum(weights[:i+1])/total*100),
+// so ranges are contiguous and never overlap or leave a gap, unlike the
+// previous version which recomputed each end from its own weight alone and
+// started the next range at end+1 regardless of what total had already been
+// consumed.
+//
+// With a 100-bucket map, an interface whose share of total weight rounds
+// down to less than one bucket (e.g. weight 1 of 101) would otherwise get a
+// negative-width range like "0--1", which nft rejects outright. Such an
+// interface is dropped from the map instead of emitted with an invalid
+// range; the next interface's range still starts right after the last
+// valid one, so the map stays contiguous and covers 0-99.
+func weightedRanges(active []ActiveInterface) []markRange {
+	total := 0
+	for _, a := range active {
+		total += weightOrOne(a.Weight)
+	}
+	cumulative := 0
+	prevEnd := -1
+	var ranges []markRange
+	for i, a := range active {
+		cumulative += weightOrOne(a.Weight)
+		end := int(float64(cumulative)/float64(total)*100) - 1
+		if i == len(active)-1 {
+			end = 99
+		}
+		start := prevEnd + 1
+		if end < start {
+			continue
+		}
+		prevEnd = end
+		ranges = append(ranges, markRange{Start: start, End: end, Mark: a.Mark})
+	}
+	return ranges
+}
+
+// formatRanges renders ranges as the raw nft map literal the CLI backend
+// shells out with, e.g. "{ 0-32 : 0x3e9,33-65 : 0x3ea }".
+func formatRanges(ranges []markRange) string {
+	parts := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		parts = append(parts, fmt.Sprintf("%d-%d : %s", r.Start, r.End, r.Mark))
+	}
+	return fmt.Sprintf("{ %s }", strings.Join(parts, ","))
+}
+
+// hashSelector builds the jhash expression over the given field names
+// ("saddr", "daddr"); an empty or unrecognized list falls back to hashing
+// both.
+func hashSelector(keys []string) string {
+	fields := map[string]string{"saddr": "ip saddr", "daddr": "ip daddr"}
+	var parts []string
+	for _, k := range keys {
+		if f, ok := fields[k]; ok {
+			parts = append(parts, f)
+		}
+	}
+	if len(parts) == 0 {
+		parts = []string{fields["saddr"], fields["daddr"]}
+	}
+	return "jhash " + strings.Join(parts, " . ")
+}
+
+// primary picks the highest-weight active interface, for failover mode.
+func primary(active []ActiveInterface) ActiveInterface {
+	best := active[0]
+	for _, a := range active[1:] {
+		if weightOrOne(a.Weight) > weightOrOne(best.Weight) {
+			best = a
+		}
+	}
+	return best
+}
+
+func weightOrOne(w int) int {
+	if w < 1 {
+		return 1
+	}
+	return w
+}
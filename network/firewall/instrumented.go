@@ -0,0 +1,85 @@
+package firewall
+
+import (
+	"context"
+	"time"
+
+	"dnshook/network/metrics"
+)
+
+// instrumentedBackend wraps an NftBackend so every call is recorded as
+// nft_cmd_total{op,result} and nft_cmd_duration_seconds{op}, regardless of
+// which concrete backend (netlink or CLI) is underneath.
+type instrumentedBackend struct {
+	NftBackend
+	m *metrics.Metrics
+}
+
+// InstrumentBackend wraps backend with Prometheus instrumentation. Pass the
+// result to anything that would otherwise take the raw backend, e.g. nft's
+// own ipset.Set handles.
+func InstrumentBackend(backend NftBackend, m *metrics.Metrics) NftBackend {
+	if m == nil {
+		return backend
+	}
+	return &instrumentedBackend{NftBackend: backend, m: m}
+}
+
+func (b *instrumentedBackend) observe(op string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	b.m.ObserveNftCmd(op, time.Since(start), err)
+	return err
+}
+
+func (b *instrumentedBackend) EnsureTable(ctx context.Context, lanInterfaces []string) error {
+	return b.observe("ensure_table", func() error { return b.NftBackend.EnsureTable(ctx, lanInterfaces) })
+}
+
+func (b *instrumentedBackend) AddSetElements(ctx context.Context, table, set string, elements []string) error {
+	return b.observe("add_set_elements", func() error { return b.NftBackend.AddSetElements(ctx, table, set, elements) })
+}
+
+func (b *instrumentedBackend) DelSetElements(ctx context.Context, table, set string, elements []string) error {
+	return b.observe("del_set_elements", func() error { return b.NftBackend.DelSetElements(ctx, table, set, elements) })
+}
+
+func (b *instrumentedBackend) FlushSet(ctx context.Context, table, set string) error {
+	return b.observe("flush_set", func() error { return b.NftBackend.FlushSet(ctx, table, set) })
+}
+
+func (b *instrumentedBackend) FlushChain(ctx context.Context, table, chain string) error {
+	return b.observe("flush_chain", func() error { return b.NftBackend.FlushChain(ctx, table, chain) })
+}
+
+func (b *instrumentedBackend) AddRule(ctx context.Context, table, chain string, rule ...string) error {
+	return b.observe("add_rule", func() error { return b.NftBackend.AddRule(ctx, table, chain, rule...) })
+}
+
+func (b *instrumentedBackend) AddMarkRule(ctx context.Context, table, chain, mark string) error {
+	return b.observe("add_mark_rule", func() error { return b.NftBackend.AddMarkRule(ctx, table, chain, mark) })
+}
+
+func (b *instrumentedBackend) AddCtMarkRestoreRule(ctx context.Context, table, chain string) error {
+	return b.observe("add_ct_mark_restore_rule", func() error { return b.NftBackend.AddCtMarkRestoreRule(ctx, table, chain) })
+}
+
+func (b *instrumentedBackend) AddWeightedMarkRule(ctx context.Context, table, chain string, opts LoadBalanceOptions, ranges []markRange) error {
+	return b.observe("add_weighted_mark_rule", func() error {
+		return b.NftBackend.AddWeightedMarkRule(ctx, table, chain, opts, ranges)
+	})
+}
+
+func (b *instrumentedBackend) DeleteTable(ctx context.Context, table string) error {
+	return b.observe("delete_table", func() error { return b.NftBackend.DeleteTable(ctx, table) })
+}
+
+func (b *instrumentedBackend) Dump(ctx context.Context, table string) (string, error) {
+	var out string
+	err := b.observe("dump", func() error {
+		var err error
+		out, err = b.NftBackend.Dump(ctx, table)
+		return err
+	})
+	return out, err
+}
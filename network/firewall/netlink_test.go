@@ -0,0 +1,82 @@
+package firewall
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/nftables"
+)
+
+func TestIpToIntervalElementsCIDR(t *testing.T) {
+	els, err := ipToIntervalElements("192.168.0.0/16")
+	if err != nil {
+		t.Fatalf("ipToIntervalElements: %v", err)
+	}
+	if len(els) != 2 {
+		t.Fatalf("got %d elements, want 2 (start, end)", len(els))
+	}
+	if !els[1].IntervalEnd {
+		t.Fatalf("second element must be flagged IntervalEnd")
+	}
+
+	start := binary.BigEndian.Uint32(els[0].Key)
+	end := binary.BigEndian.Uint32(els[1].Key)
+	wantStart := binary.BigEndian.Uint32([]byte{192, 168, 0, 0})
+	wantEnd := binary.BigEndian.Uint32([]byte{192, 169, 0, 0}) // exclusive, one past 192.168.255.255
+	if start != wantStart || end != wantEnd {
+		t.Fatalf("got range [%d, %d), want [%d, %d)", start, end, wantStart, wantEnd)
+	}
+}
+
+func TestIpToIntervalElementsBareIP(t *testing.T) {
+	els, err := ipToIntervalElements("10.0.0.5")
+	if err != nil {
+		t.Fatalf("ipToIntervalElements: %v", err)
+	}
+	if len(els) != 2 {
+		t.Fatalf("got %d elements, want 2 (start, end)", len(els))
+	}
+	start := binary.BigEndian.Uint32(els[0].Key)
+	end := binary.BigEndian.Uint32(els[1].Key)
+	wantStart := binary.BigEndian.Uint32([]byte{10, 0, 0, 5})
+	if start != wantStart || end != wantStart+1 {
+		t.Fatalf("got range [%d, %d), want [%d, %d)", start, end, wantStart, wantStart+1)
+	}
+}
+
+func TestIpToIntervalElementsRejectsGarbage(t *testing.T) {
+	if _, err := ipToIntervalElements("not-an-ip"); err == nil {
+		t.Fatal("expected an error for a non-IP input")
+	}
+}
+
+// TestToSetElementsUsesSetIntervalFlag covers the bug chunk0-1/chunk0-3
+// shared: the netlink path used to reject any CIDR outright, regardless of
+// which set it was destined for, because it had no notion of interval
+// sets at all. toSetElements now dispatches on the real *nftables.Set's own
+// Interval flag rather than guessing from a set name, so this exercises it
+// against both an interval set (vpn_only_ip_set, no_vpn_ip_set) and a plain
+// one (no_vpn_domain_ip_set) without needing a live kernel nftables
+// instance.
+func TestToSetElementsUsesSetIntervalFlag(t *testing.T) {
+	intervalSet := &nftables.Set{Name: "vpn_only_ip_set", Interval: true}
+	els, err := toSetElements(intervalSet, []string{"10.0.0.0/24"})
+	if err != nil {
+		t.Fatalf("toSetElements on interval set: %v", err)
+	}
+	if len(els) != 2 {
+		t.Fatalf("got %d elements for a CIDR on an interval set, want 2", len(els))
+	}
+
+	plainSet := &nftables.Set{Name: "no_vpn_domain_ip_set"}
+	if _, err := toSetElements(plainSet, []string{"10.0.0.0/24"}); err == nil {
+		t.Fatal("expected a CIDR to be rejected on a non-interval set")
+	}
+	els, err = toSetElements(plainSet, []string{"10.0.0.1"})
+	if err != nil {
+		t.Fatalf("toSetElements on plain set: %v", err)
+	}
+	if len(els) != 1 {
+		t.Fatalf("got %d elements for a bare IP on a plain set, want 1", len(els))
+	}
+}
@@ -0,0 +1,100 @@
+// Package ipset is a thin, backend-agnostic wrapper around a single nftables
+// set, used by the firewall package for no_vpn_domain_ip_set so set
+// bookkeeping isn't duplicated per caller.
+package ipset
+
+import (
+	"context"
+	"sync"
+
+	"dnshook/network/metrics"
+)
+
+// Backend is the subset of firewall.NftBackend that element management
+// needs; it's defined here (rather than imported) so this package stays
+// independent of the firewall package's nftables dependency.
+type Backend interface {
+	AddSetElements(ctx context.Context, table, set string, elements []string) error
+	DelSetElements(ctx context.Context, table, set string, elements []string) error
+	FlushSet(ctx context.Context, table, set string) error
+}
+
+// Set is a handle to one named nftables set within one table.
+type Set struct {
+	backend     Backend
+	table, name string
+
+	// metrics and members back the no_vpn_domain_ip_set_size gauge; the
+	// backend has no "list current elements" call cheap enough to poll, so
+	// membership is tracked locally from the Add/Del/Flush calls that
+	// already pass through this Set.
+	metrics *metrics.Metrics
+	mu      sync.Mutex
+	members map[string]struct{}
+}
+
+func New(backend Backend, table, name string) *Set {
+	return &Set{backend: backend, table: table, name: name}
+}
+
+// WithMetrics reports added/deleted elements and set size against m. Only
+// the no_vpn_domain_ip_set is instrumented this way; pass nil (the default)
+// for sets no one needs a size gauge for.
+func (s *Set) WithMetrics(m *metrics.Metrics) *Set {
+	s.metrics = m
+	s.members = map[string]struct{}{}
+	return s
+}
+
+func (s *Set) Add(ctx context.Context, elements ...string) error {
+	if len(elements) == 0 {
+		return nil
+	}
+	if err := s.backend.AddSetElements(ctx, s.table, s.name, elements); err != nil {
+		return err
+	}
+	if s.metrics != nil {
+		s.mu.Lock()
+		for _, e := range elements {
+			s.members[e] = struct{}{}
+		}
+		size := len(s.members)
+		s.mu.Unlock()
+		s.metrics.NoVpnDomainIPAdded.Add(float64(len(elements)))
+		s.metrics.NoVpnDomainIPSetSize.Set(float64(size))
+	}
+	return nil
+}
+
+func (s *Set) Del(ctx context.Context, elements ...string) error {
+	if len(elements) == 0 {
+		return nil
+	}
+	if err := s.backend.DelSetElements(ctx, s.table, s.name, elements); err != nil {
+		return err
+	}
+	if s.metrics != nil {
+		s.mu.Lock()
+		for _, e := range elements {
+			delete(s.members, e)
+		}
+		size := len(s.members)
+		s.mu.Unlock()
+		s.metrics.NoVpnDomainIPDeleted.Add(float64(len(elements)))
+		s.metrics.NoVpnDomainIPSetSize.Set(float64(size))
+	}
+	return nil
+}
+
+func (s *Set) Flush(ctx context.Context) error {
+	if err := s.backend.FlushSet(ctx, s.table, s.name); err != nil {
+		return err
+	}
+	if s.metrics != nil {
+		s.mu.Lock()
+		s.members = map[string]struct{}{}
+		s.mu.Unlock()
+		s.metrics.NoVpnDomainIPSetSize.Set(0)
+	}
+	return nil
+}
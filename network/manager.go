@@ -0,0 +1,293 @@
+// Package network owns the VPN routing lifecycle: standing up the nftables
+// table, watching each VPN interface's reachability, and keeping the
+// weighted routing chain in sync with it.
+package network
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"dnshook/network/allowlist"
+	"dnshook/network/config"
+	"dnshook/network/ethernet"
+	"dnshook/network/firewall"
+	"dnshook/network/metrics"
+	cfgstore "dnshook/pkg/config"
+	"dnshook/pkg/shutdown"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Manager owns one VPN routing setup: its own firewall state and its own
+// set of interface health checkers. Unlike the old package-level globals,
+// nothing here is shared between Manager instances, so tests can run
+// against a fake Firewall and a process can run more than one Manager.
+type Manager struct {
+	mu      sync.Mutex
+	cfg     config.Config
+	fw      firewall.Firewall
+	log     logrus.FieldLogger
+	metrics *metrics.Metrics
+
+	checkers          map[string]*ethernet.Checker
+	getNoVpnDomainIps func() []string
+	cancel            context.CancelFunc
+	allow             *allowlist.AllowList
+}
+
+func NewManager(cfg config.Config, fw firewall.Firewall, logger logrus.FieldLogger) *Manager {
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+	return &Manager{
+		cfg:      cfg,
+		fw:       fw,
+		log:      logger,
+		checkers: map[string]*ethernet.Checker{},
+	}
+}
+
+// WithMetrics registers m's collectors to be updated as this Manager's
+// interfaces change state; pass the same *metrics.Metrics to firewall.New
+// so nft command and no-vpn-domain-set metrics line up with interface
+// metrics under one /metrics endpoint.
+func (m *Manager) WithMetrics(mtr *metrics.Metrics) *Manager {
+	m.metrics = mtr
+	return m
+}
+
+// Start brings the firewall table up, starts a health checker per VPN
+// interface, and seeds the no_vpn_domain_ip_set from getNoVpnDomainIps (the
+// DNS hook's existing cache). It registers a shutdown hook that tears
+// everything back down.
+func (m *Manager) Start(ctx context.Context, getNoVpnDomainIps func() []string) error {
+	m.getNoVpnDomainIps = getNoVpnDomainIps
+	if err := m.apply(ctx); err != nil {
+		return err
+	}
+	if m.metrics != nil && m.cfg.MetricsAddr != "" {
+		srv := &http.Server{Addr: m.cfg.MetricsAddr, Handler: m.metrics.Handler()}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				m.log.WithError(err).Error("metrics server stopped")
+			}
+		}()
+		shutdown.OnShutdown(func(ctx context.Context) error {
+			return srv.Shutdown(ctx)
+		})
+	}
+	shutdown.OnShutdown(func(ctx context.Context) error {
+		return m.Stop()
+	})
+	return nil
+}
+
+func (m *Manager) apply(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.checkers = map[string]*ethernet.Checker{}
+
+	allow, err := allowlist.New(allowlist.Config{
+		NoVpnCidrs:   m.cfg.NoVpnCidrs,
+		VpnOnlyCidrs: m.cfg.VpnOnlyCidrs,
+		Interfaces:   m.cfg.Interfaces,
+	})
+	if err != nil {
+		return err
+	}
+	m.allow = allow
+
+	lanInterfaces := m.cfg.LanInterfaces
+	if len(m.cfg.Interfaces) > 0 {
+		lanInterfaces = nil
+		for _, name := range m.cfg.LanInterfaces {
+			if allowed, matched := allow.AllowInterface(name); !matched || allowed {
+				lanInterfaces = append(lanInterfaces, name)
+			}
+		}
+	}
+
+	if err := m.fw.EnsureTable(ctx, lanInterfaces); err != nil {
+		return err
+	}
+	if err := m.fw.SetNoVpnIPs(ctx, append(append([]string{}, m.cfg.NoVpnIps...), allow.NoVpnCIDRs()...)); err != nil {
+		return err
+	}
+	if err := m.fw.SetVpnOnlyIPs(ctx, allow.VpnOnlyCIDRs()); err != nil {
+		return err
+	}
+
+	pingTimeout := time.Duration(m.cfg.PingTimeoutSeconds) * time.Second
+	runCtx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+
+	for _, vpnIf := range m.cfg.VpnInterfaces {
+		checker := ethernet.New(vpnIf, pingTimeout, m.cfg.PingAddresses, m.onStatusChanged, m.log, m.metrics)
+		m.checkers[vpnIf.Name] = checker
+		go checker.KeepCheck(runCtx)
+	}
+
+	if err := m.setChainRulesLocked(ctx); err != nil {
+		m.log.WithError(err).Error("set vpn chain rules failed")
+	}
+
+	if m.getNoVpnDomainIps != nil {
+		if ips := m.filterVpnOnly(m.getNoVpnDomainIps()); len(ips) > 0 {
+			if err := m.fw.AddNoVpnDomainIP(ctx, ips...); err != nil {
+				m.log.WithError(err).Error("add no vpn domain ip failed")
+			}
+		}
+	}
+	return nil
+}
+
+// filterVpnOnly drops any ip covered by a vpn-only CIDR rule, so a
+// domain-based no-vpn decision never overrides the allowlist.
+func (m *Manager) filterVpnOnly(ips []string) []string {
+	if m.allow == nil || len(ips) == 0 {
+		return ips
+	}
+	out := make([]string, 0, len(ips))
+	for _, ipStr := range ips {
+		if ip := net.ParseIP(ipStr); ip != nil {
+			if allow, matched := m.allow.AllowIP(ip); matched && allow {
+				continue
+			}
+		}
+		out = append(out, ipStr)
+	}
+	return out
+}
+
+func (m *Manager) onStatusChanged() {
+	if err := m.setChainRules(context.Background()); err != nil {
+		m.log.WithError(err).Error("set vpn chain rules failed")
+	}
+}
+
+// setChainRules takes m.mu before reading m.checkers, since it's called
+// from checker goroutines (via onStatusChanged) concurrently with apply
+// replacing that map. apply already holds m.mu while it runs, so it calls
+// setChainRulesLocked directly instead.
+func (m *Manager) setChainRules(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.setChainRulesLocked(ctx)
+}
+
+func (m *Manager) setChainRulesLocked(ctx context.Context) error {
+	var active []firewall.ActiveInterface
+	for _, c := range m.checkers {
+		if m.metrics != nil {
+			up := 0.0
+			if c.Status() == ethernet.Up {
+				up = 1
+			}
+			m.metrics.VpnInterfaceUp.WithLabelValues(c.Name).Set(up)
+			m.metrics.VpnInterfaceWeight.WithLabelValues(c.Name).Set(float64(c.Weight))
+		}
+		// Degraded stays in rotation: it exists precisely so a single
+		// failed probe doesn't pull an interface out from under active
+		// connections the moment it's merely flaky. Only Down removes it.
+		if c.Status() == ethernet.Down {
+			continue
+		}
+		active = append(active, firewall.ActiveInterface{Name: c.Name, Mark: c.Mark, Weight: c.Weight})
+	}
+	opts := firewall.LoadBalanceOptions{
+		Mode:     firewall.LoadBalanceMode(m.cfg.LoadBalance.Mode),
+		HashKeys: m.cfg.LoadBalance.HashKeys,
+	}
+	return m.fw.SetChainRules(ctx, active, opts)
+}
+
+func (m *Manager) AddNoVpnDomainIp(ips ...string) error {
+	return m.fw.AddNoVpnDomainIP(context.Background(), m.filterVpnOnly(ips)...)
+}
+
+func (m *Manager) DelNoVpnDomainIp(ips ...string) error {
+	return m.fw.DelNoVpnDomainIP(context.Background(), ips...)
+}
+
+func (m *Manager) FlushNoVpnDomainIp() error {
+	return m.fw.FlushNoVpnDomainIP(context.Background())
+}
+
+// InterfaceStatus is a read-only snapshot of one VPN interface, for the
+// control API's status/list commands.
+type InterfaceStatus struct {
+	Name   string
+	Status string
+	Weight int
+	Mark   string
+}
+
+// Interfaces reports the current status of every configured VPN interface.
+func (m *Manager) Interfaces() []InterfaceStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]InterfaceStatus, 0, len(m.checkers))
+	for _, c := range m.checkers {
+		out = append(out, InterfaceStatus{Name: c.Name, Status: c.Status().String(), Weight: c.Weight, Mark: c.Mark})
+	}
+	return out
+}
+
+// ForceFail takes name out of rotation regardless of what its health
+// checks report, or (forced=false) returns it to normal health-checked
+// operation. It's the control API's "interface disable/enable" operation.
+func (m *Manager) ForceFail(name string, forced bool) error {
+	m.mu.Lock()
+	checker, ok := m.checkers[name]
+	m.mu.Unlock()
+	if !ok {
+		return errors.Errorf("unknown vpn interface %q", name)
+	}
+	checker.SetForcedDown(forced)
+	return nil
+}
+
+// UpdateConfig swaps in a new Config and re-applies the firewall table,
+// allowlist and health checkers against it. It's the control API's
+// "reload config" operation.
+func (m *Manager) UpdateConfig(ctx context.Context, cfg config.Config) error {
+	m.mu.Lock()
+	m.cfg = cfg
+	m.mu.Unlock()
+	return m.apply(ctx)
+}
+
+// Dump returns a human-readable listing of the firewall's current rules.
+func (m *Manager) Dump(ctx context.Context) (string, error) {
+	return m.fw.Dump(ctx)
+}
+
+// Stop cancels the health checkers and tears down the nftables table.
+func (m *Manager) Stop() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		m.cancel()
+	}
+	return m.fw.Clear(context.Background())
+}
+
+// LoadConfig reads (and watches for changes to) the on-disk config, calling
+// onChange with the new value whenever it's reloaded.
+func LoadConfig(onChange func(config.Config)) (config.Config, error) {
+	store := cfgstore.LocalYamlConfig[config.Config](config.FileName, config.Default)
+	if onChange != nil {
+		if err := store.Watch(onChange); err != nil {
+			return config.Config{}, err
+		}
+	}
+	return store.Get(), nil
+}
@@ -0,0 +1,99 @@
+// Package metrics collects vpn-manager's Prometheus instrumentation in one
+// place, following the same pattern as kilo's iptables metrics: a small
+// struct of registered collectors built once and threaded through the
+// packages that need to update them, instead of relying on the global
+// registry.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds every collector vpn-manager exposes.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	NftCmdTotal    *prometheus.CounterVec
+	NftCmdDuration *prometheus.HistogramVec
+
+	NoVpnDomainIPAdded   prometheus.Counter
+	NoVpnDomainIPDeleted prometheus.Counter
+	NoVpnDomainIPSetSize prometheus.Gauge
+
+	VpnInterfaceUp     *prometheus.GaugeVec
+	VpnInterfaceWeight *prometheus.GaugeVec
+
+	PingRTT *prometheus.HistogramVec
+}
+
+// New builds and registers every collector against a private registry, so
+// multiple Managers in one process (or tests) don't collide on the global
+// default registry.
+func New() *Metrics {
+	registry := prometheus.NewRegistry()
+	m := &Metrics{
+		registry: registry,
+		NftCmdTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nft_cmd_total",
+			Help: "Number of nftables commands run, by operation and result.",
+		}, []string{"op", "result"}),
+		NftCmdDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "nft_cmd_duration_seconds",
+			Help: "Time taken to run an nftables command, by operation.",
+		}, []string{"op"}),
+		NoVpnDomainIPAdded: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "no_vpn_domain_ip_added_total",
+			Help: "Number of IPs added to the no_vpn_domain_ip_set.",
+		}),
+		NoVpnDomainIPDeleted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "no_vpn_domain_ip_deleted_total",
+			Help: "Number of IPs removed from the no_vpn_domain_ip_set.",
+		}),
+		NoVpnDomainIPSetSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "no_vpn_domain_ip_set_size",
+			Help: "Current number of IPs tracked in the no_vpn_domain_ip_set.",
+		}),
+		VpnInterfaceUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "vpn_interface_up",
+			Help: "Whether a VPN interface's health checks currently report it up (1) or not (0).",
+		}, []string{"name"}),
+		VpnInterfaceWeight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "vpn_interface_weight",
+			Help: "Configured load-balancing weight of a VPN interface.",
+		}, []string{"name"}),
+		PingRTT: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "ping_rtt_seconds",
+			Help: "Round-trip time of a VPN interface's health-check probes.",
+		}, []string{"interface", "target"}),
+	}
+	registry.MustRegister(
+		m.NftCmdTotal,
+		m.NftCmdDuration,
+		m.NoVpnDomainIPAdded,
+		m.NoVpnDomainIPDeleted,
+		m.NoVpnDomainIPSetSize,
+		m.VpnInterfaceUp,
+		m.VpnInterfaceWeight,
+		m.PingRTT,
+	)
+	return m
+}
+
+// Handler serves the registered collectors for scraping.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveNftCmd records the outcome and duration of one nftables command.
+func (m *Metrics) ObserveNftCmd(op string, took time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.NftCmdTotal.WithLabelValues(op, result).Inc()
+	m.NftCmdDuration.WithLabelValues(op).Observe(took.Seconds())
+}
@@ -0,0 +1,173 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ConsoleConfig configures the optional line-oriented admin console. It
+// listens on plain TCP rather than speaking the real SSH protocol, the same
+// tradeoff Nebula's ssh.go makes: good enough for an operator on a trusted
+// management network, without pulling in an SSH server implementation.
+type ConsoleConfig struct {
+	Addr  string // host:port to listen on, e.g. "127.0.0.1:1234"
+	Token string // if set, required as the first line of every connection
+}
+
+// ServeConsole accepts connections on cfg.Addr and runs a REPL against svc
+// on each one until the listener is closed.
+func ServeConsole(cfg ConsoleConfig, svc *Service, log logrus.FieldLogger) error {
+	if log == nil {
+		log = logrus.StandardLogger()
+	}
+	ln, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return errors.Wrapf(err, "listen on %s", cfg.Addr)
+	}
+	defer ln.Close()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return errors.Wrap(err, "accept console connection")
+		}
+		go func() {
+			defer conn.Close()
+			if err := runConsoleSession(conn, cfg, svc); err != nil {
+				log.WithError(err).WithField("remote", conn.RemoteAddr()).Debug("console session ended")
+			}
+		}()
+	}
+}
+
+func runConsoleSession(conn net.Conn, cfg ConsoleConfig, svc *Service) error {
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+
+	if cfg.Token != "" {
+		fmt.Fprint(rw, "token: ")
+		rw.Flush()
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(line) != cfg.Token {
+			fmt.Fprintln(rw, "auth failed")
+			rw.Flush()
+			return errors.New("bad token")
+		}
+	}
+
+	fmt.Fprintln(rw, "vpnmanager console. type 'help' for commands.")
+	for {
+		fmt.Fprint(rw, "> ")
+		rw.Flush()
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		out, quit := runConsoleCommand(svc, fields)
+		fmt.Fprintln(rw, out)
+		rw.Flush()
+		if quit {
+			return nil
+		}
+	}
+}
+
+func runConsoleCommand(svc *Service, fields []string) (output string, quit bool) {
+	switch fields[0] {
+	case "help":
+		return "commands: status, route add <ip>, route del <ip>, route flush, " +
+			"interface disable <name>, interface enable <name>, reload, dump, quit", false
+	case "quit", "exit":
+		return "bye", true
+	case "status":
+		reply, err := svc.Status(context.Background(), &Empty{})
+		if err != nil {
+			return "error: " + err.Error(), false
+		}
+		var b strings.Builder
+		for _, iface := range reply.Interfaces {
+			fmt.Fprintf(&b, "%s\tstatus=%s\tweight=%d\tmark=%s\n", iface.Name, iface.Status, iface.Weight, iface.Mark)
+		}
+		return strings.TrimRight(b.String(), "\n"), false
+	case "route":
+		return runConsoleRoute(svc, fields[1:]), false
+	case "interface":
+		return runConsoleInterface(svc, fields[1:]), false
+	case "reload":
+		if _, err := svc.ReloadConfig(context.Background(), &Empty{}); err != nil {
+			return "error: " + err.Error(), false
+		}
+		return "ok", false
+	case "dump":
+		reply, err := svc.DumpState(context.Background(), &Empty{})
+		if err != nil {
+			return "error: " + err.Error(), false
+		}
+		return reply.State, false
+	default:
+		return "unknown command " + strconv.Quote(fields[0]) + "; type 'help'", false
+	}
+}
+
+func runConsoleRoute(svc *Service, args []string) string {
+	if len(args) == 0 {
+		return "usage: route add|del|flush [ip]"
+	}
+	switch args[0] {
+	case "add":
+		if len(args) != 2 {
+			return "usage: route add <ip>"
+		}
+		if _, err := svc.AddNoVpnDomainIp(context.Background(), &DomainIPRequest{IPs: args[1:2]}); err != nil {
+			return "error: " + err.Error()
+		}
+		return "ok"
+	case "del":
+		if len(args) != 2 {
+			return "usage: route del <ip>"
+		}
+		if _, err := svc.DelNoVpnDomainIp(context.Background(), &DomainIPRequest{IPs: args[1:2]}); err != nil {
+			return "error: " + err.Error()
+		}
+		return "ok"
+	case "flush":
+		if _, err := svc.FlushNoVpnDomainIp(context.Background(), &Empty{}); err != nil {
+			return "error: " + err.Error()
+		}
+		return "ok"
+	default:
+		return "usage: route add|del|flush [ip]"
+	}
+}
+
+func runConsoleInterface(svc *Service, args []string) string {
+	if len(args) != 2 {
+		return "usage: interface disable|enable <name>"
+	}
+	var disable bool
+	switch args[0] {
+	case "disable":
+		disable = true
+	case "enable":
+		disable = false
+	default:
+		return "usage: interface disable|enable <name>"
+	}
+	if _, err := svc.SetInterface(context.Background(), &InterfaceRequest{Name: args[1], Disable: disable}); err != nil {
+		return "error: " + err.Error()
+	}
+	return "ok"
+}
@@ -0,0 +1,273 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// This file plays the role protoc-gen-go/protoc-gen-go-grpc would normally
+// generate from a control.proto: message types, the ControlServer/
+// ControlClient interfaces, and the grpc.ServiceDesc wiring them to
+// google.golang.org/grpc's transport. It's hand-written because this
+// build's toolchain doesn't have protoc available, but the shapes below
+// (service desc, method handlers, client stubs) match what that generator
+// produces. Wire encoding is JSON rather than protobuf binary (see
+// jsonCodec below) since there's no .proto/protoc-compiled descriptor to
+// drive real protobuf marshaling; everything else — framing, streaming
+// support, deadlines, metadata — is genuine gRPC over HTTP/2.
+
+const serviceName = "vpnmanager.control.Control"
+
+// Empty is the request/response type for RPCs that carry no data.
+type Empty struct{}
+
+// DomainIPRequest carries one or more no-vpn-domain-ip-set members.
+type DomainIPRequest struct {
+	IPs []string `json:"ips"`
+}
+
+// InterfaceStatus is a read-only snapshot of one VPN interface.
+type InterfaceStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Weight int    `json:"weight"`
+	Mark   string `json:"mark"`
+}
+
+// StatusResponse lists every configured VPN interface's current state.
+type StatusResponse struct {
+	Interfaces []InterfaceStatus `json:"interfaces"`
+}
+
+// InterfaceRequest disables or re-enables one VPN interface.
+type InterfaceRequest struct {
+	Name    string `json:"name"`
+	Disable bool   `json:"disable"`
+}
+
+// DumpResponse carries a human-readable nftables listing.
+type DumpResponse struct {
+	State string `json:"state"`
+}
+
+// ControlServer is the interface pkg/control's gRPC server registers and
+// vpnmanagerctl's client implements calls against.
+type ControlServer interface {
+	Status(ctx context.Context, req *Empty) (*StatusResponse, error)
+	AddNoVpnDomainIp(ctx context.Context, req *DomainIPRequest) (*Empty, error)
+	DelNoVpnDomainIp(ctx context.Context, req *DomainIPRequest) (*Empty, error)
+	FlushNoVpnDomainIp(ctx context.Context, req *Empty) (*Empty, error)
+	SetInterface(ctx context.Context, req *InterfaceRequest) (*Empty, error)
+	ReloadConfig(ctx context.Context, req *Empty) (*Empty, error)
+	DumpState(ctx context.Context, req *Empty) (*DumpResponse, error)
+}
+
+// RegisterControlServer registers srv's methods against s.
+func RegisterControlServer(s *grpc.Server, srv ControlServer) {
+	s.RegisterService(&controlServiceDesc, srv)
+}
+
+func statusHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/Status"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).Status(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func addNoVpnDomainIpHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DomainIPRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).AddNoVpnDomainIp(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/AddNoVpnDomainIp"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).AddNoVpnDomainIp(ctx, req.(*DomainIPRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func delNoVpnDomainIpHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DomainIPRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).DelNoVpnDomainIp(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/DelNoVpnDomainIp"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).DelNoVpnDomainIp(ctx, req.(*DomainIPRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func flushNoVpnDomainIpHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).FlushNoVpnDomainIp(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/FlushNoVpnDomainIp"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).FlushNoVpnDomainIp(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func setInterfaceHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InterfaceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).SetInterface(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/SetInterface"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).SetInterface(ctx, req.(*InterfaceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func reloadConfigHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).ReloadConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/ReloadConfig"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).ReloadConfig(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func dumpStateHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).DumpState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/DumpState"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).DumpState(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var controlServiceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*ControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Status", Handler: statusHandler},
+		{MethodName: "AddNoVpnDomainIp", Handler: addNoVpnDomainIpHandler},
+		{MethodName: "DelNoVpnDomainIp", Handler: delNoVpnDomainIpHandler},
+		{MethodName: "FlushNoVpnDomainIp", Handler: flushNoVpnDomainIpHandler},
+		{MethodName: "SetInterface", Handler: setInterfaceHandler},
+		{MethodName: "ReloadConfig", Handler: reloadConfigHandler},
+		{MethodName: "DumpState", Handler: dumpStateHandler},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "control/control.proto",
+}
+
+// ControlClient calls a ControlServer over a grpc.ClientConn.
+type ControlClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewControlClient wraps an established connection (e.g. from grpc.Dial).
+func NewControlClient(cc *grpc.ClientConn) *ControlClient {
+	return &ControlClient{cc: cc}
+}
+
+func (c *ControlClient) Status(ctx context.Context, req *Empty) (*StatusResponse, error) {
+	out := new(StatusResponse)
+	if err := c.cc.Invoke(ctx, "/"+serviceName+"/Status", req, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ControlClient) AddNoVpnDomainIp(ctx context.Context, req *DomainIPRequest) (*Empty, error) {
+	out := new(Empty)
+	if err := c.cc.Invoke(ctx, "/"+serviceName+"/AddNoVpnDomainIp", req, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ControlClient) DelNoVpnDomainIp(ctx context.Context, req *DomainIPRequest) (*Empty, error) {
+	out := new(Empty)
+	if err := c.cc.Invoke(ctx, "/"+serviceName+"/DelNoVpnDomainIp", req, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ControlClient) FlushNoVpnDomainIp(ctx context.Context, req *Empty) (*Empty, error) {
+	out := new(Empty)
+	if err := c.cc.Invoke(ctx, "/"+serviceName+"/FlushNoVpnDomainIp", req, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ControlClient) SetInterface(ctx context.Context, req *InterfaceRequest) (*Empty, error) {
+	out := new(Empty)
+	if err := c.cc.Invoke(ctx, "/"+serviceName+"/SetInterface", req, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ControlClient) ReloadConfig(ctx context.Context, req *Empty) (*Empty, error) {
+	out := new(Empty)
+	if err := c.cc.Invoke(ctx, "/"+serviceName+"/ReloadConfig", req, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ControlClient) DumpState(ctx context.Context, req *Empty) (*DumpResponse, error) {
+	out := new(DumpResponse)
+	if err := c.cc.Invoke(ctx, "/"+serviceName+"/DumpState", req, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// jsonCodec replaces grpc-go's default "proto" codec with plain JSON, since
+// the message types above are ordinary Go structs rather than generated
+// proto.Message implementations. It's registered under the "proto" name so
+// both client and server use it without either side having to set a
+// non-default content-subtype on every call.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string { return "proto" }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
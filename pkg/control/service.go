@@ -0,0 +1,72 @@
+// Package control exposes vpn-manager's runtime operations — the ones
+// previously only reachable by editing the YAML config and restarting — as
+// a gRPC service over a Unix socket, plus a line-oriented admin console.
+package control
+
+import (
+	"context"
+
+	"dnshook/network"
+	netconfig "dnshook/network/config"
+)
+
+// Service adapts a *network.Manager to the ControlServer interface, so both
+// the gRPC server and the admin console share one implementation of every
+// operation.
+type Service struct {
+	mgr        *network.Manager
+	loadConfig func() (netconfig.Config, error)
+}
+
+var _ ControlServer = (*Service)(nil)
+
+// NewService builds a Service around mgr. loadConfig re-reads the on-disk
+// config for the Reload RPC; pass network.LoadConfig with a nil callback in
+// production.
+func NewService(mgr *network.Manager, loadConfig func() (netconfig.Config, error)) *Service {
+	return &Service{mgr: mgr, loadConfig: loadConfig}
+}
+
+func (s *Service) AddNoVpnDomainIp(ctx context.Context, req *DomainIPRequest) (*Empty, error) {
+	return &Empty{}, s.mgr.AddNoVpnDomainIp(req.IPs...)
+}
+
+func (s *Service) DelNoVpnDomainIp(ctx context.Context, req *DomainIPRequest) (*Empty, error) {
+	return &Empty{}, s.mgr.DelNoVpnDomainIp(req.IPs...)
+}
+
+func (s *Service) FlushNoVpnDomainIp(ctx context.Context, _ *Empty) (*Empty, error) {
+	return &Empty{}, s.mgr.FlushNoVpnDomainIp()
+}
+
+func (s *Service) Status(ctx context.Context, _ *Empty) (*StatusResponse, error) {
+	resp := &StatusResponse{}
+	for _, iface := range s.mgr.Interfaces() {
+		resp.Interfaces = append(resp.Interfaces, InterfaceStatus{
+			Name: iface.Name, Status: iface.Status, Weight: iface.Weight, Mark: iface.Mark,
+		})
+	}
+	return resp, nil
+}
+
+// SetInterface force-fails (Disable=true) or restores (Disable=false) one
+// VPN interface, regardless of what its health checks currently report.
+func (s *Service) SetInterface(ctx context.Context, req *InterfaceRequest) (*Empty, error) {
+	return &Empty{}, s.mgr.ForceFail(req.Name, req.Disable)
+}
+
+func (s *Service) ReloadConfig(ctx context.Context, _ *Empty) (*Empty, error) {
+	cfg, err := s.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &Empty{}, s.mgr.UpdateConfig(ctx, cfg)
+}
+
+func (s *Service) DumpState(ctx context.Context, _ *Empty) (*DumpResponse, error) {
+	state, err := s.mgr.Dump(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &DumpResponse{State: state}, nil
+}
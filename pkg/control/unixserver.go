@@ -0,0 +1,90 @@
+//go:build linux
+
+package control
+
+import (
+	"net"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc"
+)
+
+// DefaultSocketPath is where the control socket lives unless overridden by
+// config; vpnmanagerctl defaults to the same path.
+const DefaultSocketPath = "/var/run/vpnmanager.sock"
+
+// ServeUnix runs a gRPC server for srv on socketPath, accepting connections
+// from any local process whose uid matches the server's own (or root),
+// checked via SO_PEERCRED on each accepted connection. It blocks until the
+// listener is closed.
+func ServeUnix(socketPath string, srv ControlServer, log logrus.FieldLogger) error {
+	if log == nil {
+		log = logrus.StandardLogger()
+	}
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "remove stale socket %s", socketPath)
+	}
+
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return errors.Wrapf(err, "listen on %s", socketPath)
+	}
+	defer ln.Close()
+
+	grpcServer := grpc.NewServer()
+	RegisterControlServer(grpcServer, srv)
+	return grpcServer.Serve(&peerCredListener{Listener: ln, log: log})
+}
+
+// peerCredListener rejects any accepted connection that isn't root or
+// running as the same uid as this process, so the socket's file
+// permissions aren't the only thing standing between an unprivileged local
+// user and route control.
+type peerCredListener struct {
+	net.Listener
+	log logrus.FieldLogger
+}
+
+func (l *peerCredListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkPeerCred(conn); err != nil {
+			l.log.WithError(err).Warn("rejected control connection")
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+}
+
+func checkPeerCred(conn net.Conn) error {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return errors.New("not a unix connection")
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return errors.Wrap(err, "get raw conn")
+	}
+	var cred *unix.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return errors.Wrap(err, "control raw conn")
+	}
+	if credErr != nil {
+		return errors.Wrap(credErr, "get peer credentials")
+	}
+	if cred.Uid != 0 && cred.Uid != uint32(os.Getuid()) {
+		return errors.Errorf("peer uid %d is not root or %d", cred.Uid, os.Getuid())
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package control
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ServeUnix is Linux-only: SO_PEERCRED peer credential checks aren't
+// portable, and this vpn-manager only ever ships for OpenWrt/Linux targets.
+func ServeUnix(socketPath string, srv ControlServer, log logrus.FieldLogger) error {
+	return errors.New("control.ServeUnix is only supported on linux")
+}